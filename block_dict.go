@@ -0,0 +1,446 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// CompressBlockDict is like CompressBlock but additionally searches dict, an
+// external dictionary, for matches. dict is treated as if it were the winSize
+// bytes immediately preceding src, so a match may reach back into it even
+// though src is otherwise compressed independently of whatever produced dict.
+//
+// This is most useful for many small, similar payloads (RPC messages, JSON
+// documents, log lines): priming hashTable with a shared dict lets each one
+// reference the common parts instead of repeating them as literals.
+//
+// The size of hashTable must be at least 64Kb.
+//
+// The size of the compressed data is returned. If it is 0 and no error, then the data is incompressible.
+//
+// An error is returned if the destination buffer is too small.
+func CompressBlockDict(src, dst, dict []byte, hashTable []int) (di int, err error) {
+	defer recoverBlock(&err)
+
+	sn, dn := len(src)-mfLimit, len(dst)
+	if sn <= 0 || dn == 0 {
+		return 0, nil
+	}
+	var si int
+
+	dictLen := len(dict)
+	if dictLen > winSize {
+		dict = dict[dictLen-winSize:]
+		dictLen = len(dict)
+	}
+	// Prime the hash table with every 4-byte sequence in dict, using negative
+	// positions (relative to src[0]) so the main loop can tell a dict-origin
+	// reference apart from a src-origin one.
+	for i := 0; i <= dictLen-4; i++ {
+		h := blockHash(binary.LittleEndian.Uint32(dict[i:]))
+		hashTable[h] = i - dictLen
+	}
+
+	anchor := si
+
+	for si < sn {
+		// Hash the next 4 bytes (sequence)...
+		match := binary.LittleEndian.Uint32(src[si:])
+		h := blockHash(match)
+
+		ref := hashTable[h]
+		hashTable[h] = si
+		if ref >= sn || ref < -dictLen { // Invalid reference (dirty hashtable).
+			si++
+			continue
+		}
+		offset := si - ref
+		if offset <= 0 || offset >= winSize || // Out of window.
+			dictWord(src, dict, dictLen, ref) != match { // Hash collision on different matches.
+			si++
+			continue
+		}
+
+		// Match found.
+		lLen := si - anchor // Literal length.
+
+		// Encode match length part 1.
+		si += minMatch
+		mLen := si
+		si = dictExtend(src, dict, dictLen, ref+minMatch, si, sn)
+		mLen = si - mLen
+
+		if mLen < 0xF {
+			dst[di] = byte(mLen)
+		} else {
+			dst[di] = 0xF
+		}
+
+		// Encode literals length.
+		if lLen < 0xF {
+			dst[di] |= byte(lLen << 4)
+		} else {
+			dst[di] |= 0xF0
+			di++
+			l := lLen - 0xF
+			for ; l >= 0xFF; l -= 0xFF {
+				dst[di] = 0xFF
+				di++
+			}
+			dst[di] = byte(l)
+		}
+		di++
+
+		// Literals.
+		copy(dst[di:di+lLen], src[anchor:anchor+lLen])
+		di += lLen + 2
+		anchor = si
+
+		// Encode offset.
+		_ = dst[di] // Bound check elimination.
+		dst[di-2], dst[di-1] = byte(offset), byte(offset>>8)
+
+		// Encode match length part 2.
+		if mLen >= 0xF {
+			for mLen -= 0xF; mLen >= 0xFF; mLen -= 0xFF {
+				dst[di] = 0xFF
+				di++
+			}
+			dst[di] = byte(mLen)
+			di++
+		}
+	}
+
+	if anchor == 0 {
+		// Incompressible.
+		return 0, nil
+	}
+
+	// Last literals.
+	lLen := len(src) - anchor
+	if lLen < 0xF {
+		dst[di] = byte(lLen << 4)
+	} else {
+		dst[di] = 0xF0
+		di++
+		for lLen -= 0xF; lLen >= 0xFF; lLen -= 0xFF {
+			dst[di] = 0xFF
+			di++
+		}
+		dst[di] = byte(lLen)
+	}
+	di++
+
+	// Write the last literals.
+	if di >= anchor {
+		// Incompressible.
+		return 0, nil
+	}
+	di += copy(dst[di:di+len(src)-anchor], src[anchor:])
+	return di, nil
+}
+
+// CompressBlockHCDict is like CompressBlockHC but additionally searches dict,
+// an external dictionary, for matches. See CompressBlockDict for how dict is
+// addressed relative to src.
+//
+// An error is returned if the destination buffer is too small.
+func CompressBlockHCDict(src, dst, dict []byte, depth int) (di int, err error) {
+	defer recoverBlock(&err)
+
+	sn, dn := len(src)-mfLimit, len(dst)
+	if sn <= 0 || dn == 0 {
+		return 0, nil
+	}
+	var si int
+
+	// hashTable: stores the last position found for a given hash
+	// chainTable: stores previous positions for a given hash
+	var hashTable, chainTable [winSize]int
+
+	dictLen := len(dict)
+	if dictLen > winSize {
+		dict = dict[dictLen-winSize:]
+		dictLen = len(dict)
+	}
+	for i := 0; i <= dictLen-4; i++ {
+		p := i - dictLen
+		h := blockHash(binary.LittleEndian.Uint32(dict[i:]))
+		chainTable[p&winMask] = hashTable[h]
+		hashTable[h] = p
+	}
+
+	if depth <= 0 {
+		depth = winSize
+	}
+
+	anchor := si
+	for si < sn {
+		// Hash the next 4 bytes (sequence).
+		match := binary.LittleEndian.Uint32(src[si:])
+		h := blockHash(match)
+
+		// Follow the chain until out of window and give the longest match.
+		mLen := 0
+		offset := 0
+		for next, try := hashTable[h], depth; try > 0 && next != 0 && next >= -dictLen && si-next < winSize; next = chainTable[next&winMask] {
+			// The first (mLen==0) or next byte (mLen>=minMatch) at current match length
+			// must match to improve on the match length.
+			if dictByte(src, dict, dictLen, next+mLen) != src[si+mLen] {
+				continue
+			}
+			ml := dictExtend(src, dict, dictLen, next, si, sn) - si
+			if ml < minMatch || ml <= mLen {
+				// Match too small (<minMatch) or smaller than the current match.
+				continue
+			}
+			// Found a longer match, keep its position and length.
+			mLen = ml
+			offset = si - next
+			// Try another previous position with the same hash.
+			try--
+		}
+		chainTable[si&winMask] = hashTable[h]
+		hashTable[h] = si
+
+		// No match found.
+		if mLen == 0 {
+			si++
+			continue
+		}
+
+		// Match found.
+		// Update hash/chain tables with overlapping bytes:
+		// si already hashed, add everything from si+1 up to the match length.
+		winStart := si + 1
+		if ws := si + mLen - winSize; ws > winStart {
+			winStart = ws
+		}
+		for si, ml := winStart, si+mLen; si < ml; {
+			match >>= 8
+			match |= uint32(src[si+3]) << 24
+			h := blockHash(match)
+			chainTable[si&winMask] = hashTable[h]
+			hashTable[h] = si
+			si++
+		}
+
+		lLen := si - anchor
+		si += mLen
+		mLen -= minMatch // Match length does not include minMatch.
+
+		if mLen < 0xF {
+			dst[di] = byte(mLen)
+		} else {
+			dst[di] = 0xF
+		}
+
+		// Encode literals length.
+		if lLen < 0xF {
+			dst[di] |= byte(lLen << 4)
+		} else {
+			dst[di] |= 0xF0
+			di++
+			l := lLen - 0xF
+			for ; l >= 0xFF; l -= 0xFF {
+				dst[di] = 0xFF
+				di++
+			}
+			dst[di] = byte(l)
+		}
+		di++
+
+		// Literals.
+		copy(dst[di:di+lLen], src[anchor:anchor+lLen])
+		di += lLen
+		anchor = si
+
+		// Encode offset.
+		di += 2
+		dst[di-2], dst[di-1] = byte(offset), byte(offset>>8)
+
+		// Encode match length part 2.
+		if mLen >= 0xF {
+			for mLen -= 0xF; mLen >= 0xFF; mLen -= 0xFF {
+				dst[di] = 0xFF
+				di++
+			}
+			dst[di] = byte(mLen)
+			di++
+		}
+	}
+
+	if anchor == 0 {
+		// Incompressible.
+		return 0, nil
+	}
+
+	// Last literals.
+	lLen := len(src) - anchor
+	if lLen < 0xF {
+		dst[di] = byte(lLen << 4)
+	} else {
+		dst[di] = 0xF0
+		di++
+		lLen -= 0xF
+		for ; lLen >= 0xFF; lLen -= 0xFF {
+			dst[di] = 0xFF
+			di++
+		}
+		dst[di] = byte(lLen)
+	}
+	di++
+
+	// Write the last literals.
+	if di >= anchor {
+		// Incompressible.
+		return 0, nil
+	}
+	di += copy(dst[di:di+len(src)-anchor], src[anchor:])
+	return di, nil
+}
+
+// dictByte returns the byte at virtual position p, where p < 0 indexes into
+// the last dictLen bytes of dict (dict[dictLen+p], i.e. as if dict sat
+// immediately before src[0]) and p >= 0 indexes into src.
+func dictByte(src, dict []byte, dictLen, p int) byte {
+	if p >= 0 {
+		return src[p]
+	}
+	return dict[dictLen+p]
+}
+
+// dictWord is like dictByte but reads a 4-byte little-endian word, handling
+// the case where it straddles the dict/src boundary.
+func dictWord(src, dict []byte, dictLen, p int) uint32 {
+	if p >= 0 {
+		return binary.LittleEndian.Uint32(src[p:])
+	}
+	i := dictLen + p
+	if i+4 <= dictLen {
+		return binary.LittleEndian.Uint32(dict[i:])
+	}
+	var buf [4]byte
+	n := copy(buf[:], dict[i:])
+	copy(buf[n:], src)
+	return binary.LittleEndian.Uint32(buf[:])
+}
+
+// dictExtend grows a match starting at the virtual position ref (see
+// dictByte) against src[si:], stopping at the first mismatch or at sn, and
+// returns the resulting si. Reads never cross from src back into dict past
+// the dict boundary: once ref catches up to src[0] the comparison continues
+// entirely within src, the same as the dict-less encoders.
+func dictExtend(src, dict []byte, dictLen, ref, si, sn int) int {
+	for ref < 0 {
+		if si >= sn || dictByte(src, dict, dictLen, ref) != src[si] {
+			// Mismatch (or ran out of src) while still inside dict: stop
+			// here rather than falling into the src-only batch loop below,
+			// which would read src[ref:] with a negative ref.
+			return si
+		}
+		ref++
+		si++
+	}
+	for si < sn {
+		x := binary.LittleEndian.Uint64(src[si:]) ^ binary.LittleEndian.Uint64(src[ref:])
+		if x == 0 {
+			si += 8
+			ref += 8
+		} else {
+			si += bits.TrailingZeros64(x) >> 3
+			break
+		}
+	}
+	return si
+}
+
+// UncompressBlockDict is like UncompressBlock but treats dict as the external
+// dictionary that CompressBlockDict or CompressBlockHCDict used to produce
+// src: dict is addressed as if it were placed immediately before dst[0].
+//
+// The destination buffer must be sized appropriately.
+//
+// An error is returned if the source data is invalid or the destination buffer is too small.
+func UncompressBlockDict(src, dst, dict []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, nil
+	}
+	if di := decodeBlockDict(dst, src, dict); di >= 0 {
+		return di, nil
+	}
+	return 0, ErrInvalidSourceShortBuffer
+}
+
+// decodeBlockDict is like decodeBlock but resolves match offsets that reach
+// past di against the tail of dict instead of failing.
+func decodeBlockDict(dst, src, dict []byte) (di int) {
+	defer func() {
+		if recover() != nil {
+			di = -2
+		}
+	}()
+
+	dictLen := len(dict)
+	var si int
+	for si < len(src) {
+		b := src[si]
+		si++
+
+		if lLen := int(b >> 4); lLen > 0 {
+			if lLen == 0xF {
+				for src[si] == 0xFF {
+					lLen += 0xFF
+					si++
+				}
+				lLen += int(src[si])
+				si++
+			}
+			copy(dst[di:di+lLen], src[si:si+lLen])
+			si += lLen
+			di += lLen
+		}
+		if si >= len(src) {
+			return di
+		}
+
+		offset := int(src[si]) | int(src[si+1])<<8
+		si += 2
+		if offset == 0 {
+			return -1
+		}
+
+		mLen := int(b&0xF) + minMatch
+		if mLen == minMatch+0xF {
+			for src[si] == 0xFF {
+				mLen += 0xFF
+				si++
+			}
+			mLen += int(src[si])
+			si++
+		}
+
+		ref := di - offset
+		if ref < 0 {
+			// Match reaches back into dict.
+			dictRef := dictLen + ref
+			if dictRef < 0 {
+				return -1
+			}
+			n := -ref
+			if n > mLen {
+				n = mLen
+			}
+			copy(dst[di:di+n], dict[dictRef:dictRef+n])
+			di += n
+			mLen -= n
+			ref = 0
+		}
+		for ; mLen > 0; mLen-- {
+			dst[di] = dst[ref]
+			di++
+			ref++
+		}
+	}
+	return di
+}
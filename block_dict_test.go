@@ -0,0 +1,86 @@
+package lz4
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressUncompressBlockDict(t *testing.T) {
+	dict := []byte("the quick brown fox jumps over the lazy dog, repeated for padding. ")
+	src := []byte("the quick brown fox jumps over the lazy dog, repeated for padding. and then some unique trailing text")
+
+	hashTable := make([]int, 1<<16)
+	dst := make([]byte, CompressBlockBound(len(src)))
+	n, err := CompressBlockDict(src, dst, dict, hashTable)
+	if err != nil {
+		t.Fatalf("CompressBlockDict: %v", err)
+	}
+	if n == 0 {
+		t.Fatalf("CompressBlockDict: got incompressible, expected a dict-sourced match")
+	}
+
+	out := make([]byte, len(src))
+	dn, err := UncompressBlockDict(dst[:n], out, dict)
+	if err != nil {
+		t.Fatalf("UncompressBlockDict: %v", err)
+	}
+	if dn != len(src) || !bytes.Equal(out[:dn], src) {
+		t.Fatalf("round trip mismatch: got %q, want %q", out[:dn], src)
+	}
+}
+
+func TestCompressUncompressBlockHCDict(t *testing.T) {
+	dict := []byte("the quick brown fox jumps over the lazy dog, repeated for padding. ")
+	src := []byte("the quick brown fox jumps over the lazy dog, repeated for padding. and then some unique trailing text")
+
+	dst := make([]byte, CompressBlockBound(len(src)))
+	n, err := CompressBlockHCDict(src, dst, dict, 0)
+	if err != nil {
+		t.Fatalf("CompressBlockHCDict: %v", err)
+	}
+	if n == 0 {
+		t.Fatalf("CompressBlockHCDict: got incompressible, expected a dict-sourced match")
+	}
+
+	out := make([]byte, len(src))
+	dn, err := UncompressBlockDict(dst[:n], out, dict)
+	if err != nil {
+		t.Fatalf("UncompressBlockDict: %v", err)
+	}
+	if dn != len(src) || !bytes.Equal(out[:dn], src) {
+		t.Fatalf("round trip mismatch: got %q, want %q", out[:dn], src)
+	}
+}
+
+// TestCompressBlockDictBeatsNoDict checks that a block whose only repeated
+// content lives in an external dictionary compresses meaningfully better
+// with CompressBlockDict than CompressBlock can manage on its own, since the
+// shared text appears exactly once in src and so gives the dict-less
+// compressor nothing to match against.
+func TestCompressBlockDictBeatsNoDict(t *testing.T) {
+	shared := []byte("Sphinx of black quartz, judge my vow! 0123456789 abcdefghijklmnopqrstuvwxyz")
+	dict := append(bytes.Repeat([]byte{'.'}, 64), shared...)
+	src := append(append([]byte{}, shared...), []byte(" - trailing filler unique to this message !@#$%^&*()")...)
+
+	hashTable := make([]int, 1<<16)
+	dst := make([]byte, CompressBlockBound(len(src)))
+	withDict, err := CompressBlockDict(src, dst, dict, hashTable)
+	if err != nil {
+		t.Fatalf("CompressBlockDict: %v", err)
+	}
+	if withDict == 0 {
+		t.Fatalf("CompressBlockDict: got incompressible, expected a dict-sourced match")
+	}
+
+	for i := range hashTable {
+		hashTable[i] = 0
+	}
+	dst2 := make([]byte, CompressBlockBound(len(src)))
+	withoutDict, err := CompressBlock(src, dst2, hashTable)
+	if err != nil {
+		t.Fatalf("CompressBlock: %v", err)
+	}
+	if withoutDict != 0 && withDict >= withoutDict {
+		t.Fatalf("expected dict-primed compression (%d bytes) to beat plain compression (%d bytes)", withDict, withoutDict)
+	}
+}
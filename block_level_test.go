@@ -0,0 +1,42 @@
+package lz4
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressBlockLevelRoundTrip(t *testing.T) {
+	src := bytes.Repeat([]byte("lazy-matching level payload with some repeats repeats repeats "), 30)
+
+	for level := 1; level <= 9; level++ {
+		var state CompressorState
+		dst := make([]byte, CompressBlockBound(len(src)))
+		n, err := CompressBlockLevel(src, dst, level, &state)
+		if err != nil {
+			t.Fatalf("level %d: CompressBlockLevel: %v", level, err)
+		}
+		if n == 0 {
+			t.Fatalf("level %d: expected compressible input", level)
+		}
+		roundTripBlock(t, src, dst[:n])
+	}
+}
+
+// TestCompressBlockLevelStateReuseAcrossLevels checks that a single
+// CompressorState can be reused across calls at differing levels (the
+// fast, lazy and HC tables are independent) without corrupting any of them.
+func TestCompressBlockLevelStateReuseAcrossLevels(t *testing.T) {
+	src := bytes.Repeat([]byte("state reused across differing levels on each call "), 20)
+	var state CompressorState
+	for _, level := range []int{1, 3, 7, 2, 9, 4} {
+		dst := make([]byte, CompressBlockBound(len(src)))
+		n, err := CompressBlockLevel(src, dst, level, &state)
+		if err != nil {
+			t.Fatalf("level %d: CompressBlockLevel: %v", level, err)
+		}
+		if n == 0 {
+			t.Fatalf("level %d: expected compressible input", level)
+		}
+		roundTripBlock(t, src, dst[:n])
+	}
+}
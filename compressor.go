@@ -0,0 +1,387 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+)
+
+// Compressor compresses independent blocks with the same fast, single-probe
+// strategy as CompressBlock, but owns its hash table instead of requiring
+// the caller to allocate one for every call.
+//
+// Reset must be called between unrelated blocks (or simply left unused: the
+// zero value starts in a reset state) so that one block's matches never leak
+// into the next one's output.
+//
+// The zero value is ready to use. A Compressor must not be used concurrently.
+type Compressor struct {
+	table [winSize]int
+	gen   [winSize]uint32
+	cur   uint32
+}
+
+// Reset discards c's match history, as if it had just been allocated.
+//
+// Instead of zeroing the whole table, Reset retires the current generation
+// so stale slots read as empty until they are overwritten; only the
+// generation marks are ever cleared, on the rare uint32 wraparound.
+func (c *Compressor) Reset() {
+	c.cur++
+	if c.cur == 0 {
+		c.gen = [winSize]uint32{}
+		c.cur = 1
+	}
+}
+
+// CompressBlock is the Compressor equivalent of the free function
+// CompressBlock: it compresses src into dst, reusing c's hash table instead
+// of allocating one.
+//
+// The size of the compressed data is returned. If it is 0 and no error, then the data is incompressible.
+//
+// An error is returned if the destination buffer is too small.
+func (c *Compressor) CompressBlock(src, dst []byte) (di int, err error) {
+	if c.cur == 0 {
+		c.Reset()
+	}
+	defer recoverBlock(&err)
+
+	sn, dn := len(src)-mfLimit, len(dst)
+	if sn <= 0 || dn == 0 {
+		return 0, nil
+	}
+	var si int
+
+	anchor := si
+
+	for si < sn {
+		match := binary.LittleEndian.Uint32(src[si:])
+		h := blockHash(match)
+
+		var ref int
+		if c.gen[h] == c.cur {
+			ref = c.table[h]
+		} else {
+			ref = -1
+		}
+		c.table[h] = si
+		c.gen[h] = c.cur
+		if ref < 0 || ref >= sn { // Invalid reference (empty or dirty slot).
+			si++
+			continue
+		}
+		offset := si - ref
+		if offset <= 0 || offset >= winSize || // Out of window.
+			match != binary.LittleEndian.Uint32(src[ref:]) { // Hash collision on different matches.
+			si++
+			continue
+		}
+
+		// Match found.
+		lLen := si - anchor // Literal length.
+
+		// Encode match length part 1.
+		si += minMatch
+		mLen := si
+		for si < sn {
+			x := binary.LittleEndian.Uint64(src[si:]) ^ binary.LittleEndian.Uint64(src[si-offset:])
+			if x == 0 {
+				si += 8
+			} else {
+				si += bits.TrailingZeros64(x) >> 3
+				break
+			}
+		}
+		mLen = si - mLen
+
+		if mLen < 0xF {
+			dst[di] = byte(mLen)
+		} else {
+			dst[di] = 0xF
+		}
+
+		// Encode literals length.
+		if lLen < 0xF {
+			dst[di] |= byte(lLen << 4)
+		} else {
+			dst[di] |= 0xF0
+			di++
+			l := lLen - 0xF
+			for ; l >= 0xFF; l -= 0xFF {
+				dst[di] = 0xFF
+				di++
+			}
+			dst[di] = byte(l)
+		}
+		di++
+
+		// Literals.
+		copy(dst[di:di+lLen], src[anchor:anchor+lLen])
+		di += lLen + 2
+		anchor = si
+
+		// Encode offset.
+		_ = dst[di] // Bound check elimination.
+		dst[di-2], dst[di-1] = byte(offset), byte(offset>>8)
+
+		// Encode match length part 2.
+		if mLen >= 0xF {
+			for mLen -= 0xF; mLen >= 0xFF; mLen -= 0xFF {
+				dst[di] = 0xFF
+				di++
+			}
+			dst[di] = byte(mLen)
+			di++
+		}
+	}
+
+	if anchor == 0 {
+		// Incompressible.
+		return 0, nil
+	}
+
+	// Last literals.
+	lLen := len(src) - anchor
+	if lLen < 0xF {
+		dst[di] = byte(lLen << 4)
+	} else {
+		dst[di] = 0xF0
+		di++
+		for lLen -= 0xF; lLen >= 0xFF; lLen -= 0xFF {
+			dst[di] = 0xFF
+			di++
+		}
+		dst[di] = byte(lLen)
+	}
+	di++
+
+	// Write the last literals.
+	if di >= anchor {
+		// Incompressible.
+		return 0, nil
+	}
+	di += copy(dst[di:di+len(src)-anchor], src[anchor:])
+	return di, nil
+}
+
+// CompressorHC is the reusable equivalent of CompressBlockHC: it owns the
+// hash and chain tables that CompressBlockHC otherwise allocates (1MiB on
+// 64-bit) on every call, which dominates cost for small blocks and high
+// call rates.
+//
+// Reset must be called between unrelated blocks (the zero value starts in a
+// reset state) so that one block's matches never leak into the next one's
+// output.
+//
+// The zero value is ready to use. A CompressorHC must not be used concurrently.
+type CompressorHC struct {
+	hashTable  [winSize]int
+	chainTable [winSize]int
+	gen        [winSize]uint32
+	cur        uint32
+}
+
+// Reset discards c's match history, as if it had just been allocated.
+//
+// Instead of zeroing the whole table, Reset retires the current generation
+// so stale slots read as empty until they are overwritten; only the
+// generation marks are ever cleared, on the rare uint32 wraparound.
+func (c *CompressorHC) Reset() {
+	c.cur++
+	if c.cur == 0 {
+		c.gen = [winSize]uint32{}
+		c.cur = 1
+	}
+}
+
+// CompressBlock is the CompressorHC equivalent of the free function
+// CompressBlockHC: it compresses src into dst with max search depth (use 0
+// or a negative value for no max), reusing c's hash and chain tables instead
+// of allocating them.
+//
+// The size of the compressed data is returned. If it is 0 and no error, then the data is not compressible.
+//
+// An error is returned if the destination buffer is too small.
+func (c *CompressorHC) CompressBlock(src, dst []byte, depth int) (di int, err error) {
+	if c.cur == 0 {
+		c.Reset()
+	}
+	defer recoverBlock(&err)
+
+	sn, dn := len(src)-mfLimit, len(dst)
+	if sn <= 0 || dn == 0 {
+		return 0, nil
+	}
+	var si int
+
+	if depth <= 0 {
+		depth = winSize
+	}
+
+	anchor := si
+	for si < sn {
+		// Hash the next 4 bytes (sequence).
+		match := binary.LittleEndian.Uint32(src[si:])
+		h := blockHash(match)
+
+		var head int
+		if c.gen[h] == c.cur {
+			head = c.hashTable[h]
+		} else {
+			head = -1
+		}
+
+		// Follow the chain until out of window and give the longest match.
+		mLen := 0
+		offset := 0
+		for next, try := head, depth; try > 0 && next >= 0 && si-next < winSize; next = c.chainTable[next&winMask] {
+			if src[next+mLen] != src[si+mLen] {
+				continue
+			}
+			ml := 0
+			for ml < sn-si {
+				x := binary.LittleEndian.Uint64(src[next+ml:]) ^ binary.LittleEndian.Uint64(src[si+ml:])
+				if x == 0 {
+					ml += 8
+				} else {
+					ml += bits.TrailingZeros64(x) >> 3
+					break
+				}
+			}
+			if ml < minMatch || ml <= mLen {
+				continue
+			}
+			mLen = ml
+			offset = si - next
+			try--
+		}
+		c.chainTable[si&winMask] = head
+		c.hashTable[h] = si
+		c.gen[h] = c.cur
+
+		// No match found.
+		if mLen == 0 {
+			si++
+			continue
+		}
+
+		// Match found.
+		// Update hash/chain tables with overlapping bytes:
+		// si already hashed, add everything from si+1 up to the match length.
+		winStart := si + 1
+		if ws := si + mLen - winSize; ws > winStart {
+			winStart = ws
+		}
+		for si, ml := winStart, si+mLen; si < ml; {
+			match >>= 8
+			match |= uint32(src[si+3]) << 24
+			h := blockHash(match)
+			if c.gen[h] == c.cur {
+				c.chainTable[si&winMask] = c.hashTable[h]
+			} else {
+				c.chainTable[si&winMask] = -1
+			}
+			c.hashTable[h] = si
+			c.gen[h] = c.cur
+			si++
+		}
+
+		lLen := si - anchor
+		si += mLen
+		mLen -= minMatch // Match length does not include minMatch.
+
+		if mLen < 0xF {
+			dst[di] = byte(mLen)
+		} else {
+			dst[di] = 0xF
+		}
+
+		// Encode literals length.
+		if lLen < 0xF {
+			dst[di] |= byte(lLen << 4)
+		} else {
+			dst[di] |= 0xF0
+			di++
+			l := lLen - 0xF
+			for ; l >= 0xFF; l -= 0xFF {
+				dst[di] = 0xFF
+				di++
+			}
+			dst[di] = byte(l)
+		}
+		di++
+
+		// Literals.
+		copy(dst[di:di+lLen], src[anchor:anchor+lLen])
+		di += lLen
+		anchor = si
+
+		// Encode offset.
+		di += 2
+		dst[di-2], dst[di-1] = byte(offset), byte(offset>>8)
+
+		// Encode match length part 2.
+		if mLen >= 0xF {
+			for mLen -= 0xF; mLen >= 0xFF; mLen -= 0xFF {
+				dst[di] = 0xFF
+				di++
+			}
+			dst[di] = byte(mLen)
+			di++
+		}
+	}
+
+	if anchor == 0 {
+		// Incompressible.
+		return 0, nil
+	}
+
+	// Last literals.
+	lLen := len(src) - anchor
+	if lLen < 0xF {
+		dst[di] = byte(lLen << 4)
+	} else {
+		dst[di] = 0xF0
+		di++
+		lLen -= 0xF
+		for ; lLen >= 0xFF; lLen -= 0xFF {
+			dst[di] = 0xFF
+			di++
+		}
+		dst[di] = byte(lLen)
+	}
+	di++
+
+	// Write the last literals.
+	if di >= anchor {
+		// Incompressible.
+		return 0, nil
+	}
+	di += copy(dst[di:di+len(src)-anchor], src[anchor:])
+	return di, nil
+}
+
+// hcCompressorPool lets CompressBlockHC reuse a CompressorHC's tables across
+// calls instead of allocating a fresh pair of [winSize]int arrays (1MiB on
+// 64-bit) every time, since CompressBlockHC has no caller-supplied table to
+// thread that state through.
+var hcCompressorPool = sync.Pool{
+	New: func() interface{} { return new(CompressorHC) },
+}
+
+// CompressBlockHC compresses the source buffer src into the destination dst
+// with max search depth (use 0 or negative value for no max).
+//
+// CompressBlockHC compression ratio is better than CompressBlock but it is also slower.
+//
+// The size of the compressed data is returned. If it is 0 and no error, then the data is not compressible.
+//
+// An error is returned if the destination buffer is too small.
+func CompressBlockHC(src, dst []byte, depth int) (int, error) {
+	c := hcCompressorPool.Get().(*CompressorHC)
+	c.Reset()
+	di, err := c.CompressBlock(src, dst, depth)
+	hcCompressorPool.Put(c)
+	return di, err
+}
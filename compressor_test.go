@@ -0,0 +1,99 @@
+package lz4
+
+import (
+	"bytes"
+	"testing"
+)
+
+func roundTripBlock(t *testing.T, src, compressed []byte) {
+	t.Helper()
+	out := make([]byte, len(src))
+	n, err := UncompressBlock(compressed, out)
+	if err != nil {
+		t.Fatalf("UncompressBlock: %v", err)
+	}
+	if n != len(src) || !bytes.Equal(out[:n], src) {
+		t.Fatalf("round trip mismatch: got %q, want %q", out[:n], src)
+	}
+}
+
+func TestCompressorRoundTrip(t *testing.T) {
+	src := bytes.Repeat([]byte("reusable compressor round trip payload "), 20)
+	dst := make([]byte, CompressBlockBound(len(src)))
+
+	var c Compressor
+	n, err := c.CompressBlock(src, dst)
+	if err != nil {
+		t.Fatalf("CompressBlock: %v", err)
+	}
+	if n == 0 {
+		t.Fatalf("expected compressible input")
+	}
+	roundTripBlock(t, src, dst[:n])
+}
+
+func TestCompressorHCRoundTrip(t *testing.T) {
+	src := bytes.Repeat([]byte("reusable HC compressor round trip payload "), 20)
+	dst := make([]byte, CompressBlockBound(len(src)))
+
+	var c CompressorHC
+	n, err := c.CompressBlock(src, dst, 0)
+	if err != nil {
+		t.Fatalf("CompressBlock: %v", err)
+	}
+	if n == 0 {
+		t.Fatalf("expected compressible input")
+	}
+	roundTripBlock(t, src, dst[:n])
+}
+
+// TestCompressorHCReuseAcrossSizes is a regression test for a bug where
+// CompressorHC's interior "hash overlapping match bytes" loop wrote a stale,
+// ungated c.hashTable[h] value into c.chainTable, so a chain walk in a
+// smaller call following a much larger one through the same instance could
+// index src out of range instead of being masked off by the generation
+// check (as the head lookup already was).
+func TestCompressorHCReuseAcrossSizes(t *testing.T) {
+	var c CompressorHC
+
+	big := bytes.Repeat([]byte("large buffer so the hash table fills up with high offsets "), 2000)
+	bigDst := make([]byte, CompressBlockBound(len(big)))
+	if _, err := c.CompressBlock(big, bigDst, 0); err != nil {
+		t.Fatalf("CompressBlock(big): %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		small := []byte("tiny trailing buffer reused right after the big one")
+		smallDst := make([]byte, CompressBlockBound(len(small)))
+		c.Reset()
+		n, err := c.CompressBlock(small, smallDst, 0)
+		if err != nil {
+			t.Fatalf("CompressBlock(small) iteration %d: %v", i, err)
+		}
+		if n > 0 {
+			roundTripBlock(t, small, smallDst[:n])
+		}
+	}
+}
+
+// TestCompressBlockHCPoolReuseAcrossSizes exercises the same big-then-small
+// reuse pattern through the free function's sync.Pool of CompressorHCs,
+// which is the realistic high-throughput/server scenario this request
+// targeted.
+func TestCompressBlockHCPoolReuseAcrossSizes(t *testing.T) {
+	big := bytes.Repeat([]byte("large buffer exercising the sync.Pool-backed CompressBlockHC "), 2000)
+	bigDst := make([]byte, CompressBlockBound(len(big)))
+	if _, err := CompressBlockHC(big, bigDst, 0); err != nil {
+		t.Fatalf("CompressBlockHC(big): %v", err)
+	}
+
+	small := []byte("small buffer right after a big one through the same pool")
+	smallDst := make([]byte, CompressBlockBound(len(small)))
+	n, err := CompressBlockHC(small, smallDst, 0)
+	if err != nil {
+		t.Fatalf("CompressBlockHC(small): %v", err)
+	}
+	if n > 0 {
+		roundTripBlock(t, small, smallDst[:n])
+	}
+}